@@ -0,0 +1,159 @@
+// Package changelist implements a persistent queue of pending metadata
+// mutations, staged locally before being applied and published to Notary in
+// a single batch.
+package changelist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Action identifies the kind of mutation a Change represents.
+type Action string
+
+// Valid Actions.
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Scope identifies which part of the metadata tree a Change applies to.
+type Scope string
+
+// Valid Scopes.
+const (
+	ScopeTargets     Scope = "targets"
+	ScopeDelegations Scope = "delegations"
+	ScopeRootRole    Scope = "root-role"
+	ScopeWitness     Scope = "witness"
+)
+
+// Change is a single pending mutation to a role's metadata, queued locally
+// until it is applied and published to Notary.
+type Change struct {
+	Action  Action `json:"action"`
+	Scope   Scope  `json:"scope"`
+	Role    string `json:"role"`
+	Path    string `json:"path"`
+	Content []byte `json:"content,omitempty"`
+}
+
+// Witness builds a Change that re-signs role at its current version with no
+// content changes, to recover a role out of invalid-metadata state without
+// republishing its contents.
+func Witness(role string) Change {
+	return Change{Action: ActionUpdate, Scope: ScopeWitness, Role: role}
+}
+
+// Changelist is a persistent, ordered queue of pending Changes for a single
+// repo, stored as individual JSON files under a changelist/ subdirectory of
+// the same baseDir localRepo.baseDir() returns. mu serializes Add within a
+// process, so two goroutines sharing a Changelist can't compute the same
+// ordinal and silently clobber each other's entry; it does not protect
+// against two separate processes writing to the same dir concurrently.
+type Changelist struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewChangelist opens (creating if necessary) the changelist rooted at
+// baseDir.
+func NewChangelist(baseDir string) (*Changelist, error) {
+	dir := filepath.Join(baseDir, "changelist")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "changelist: create directory")
+	}
+	return &Changelist{dir: dir}, nil
+}
+
+// Add persists c as the next entry in the changelist.
+func (cl *Changelist) Add(c Change) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	entries, err := cl.list()
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%05d_%s_%s.change", len(entries), sanitizeForFilename(c.Role), c.Action)
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "changelist: marshal change")
+	}
+	if err := ioutil.WriteFile(filepath.Join(cl.dir, name), data, 0644); err != nil {
+		return errors.Wrap(err, "changelist: write change")
+	}
+	return nil
+}
+
+// sanitizeForFilename replaces path separators in role (routinely a
+// delegation path like "targets/releases") so it can't be read as a
+// subdirectory component of the filename it's embedded in.
+func sanitizeForFilename(role string) string {
+	return strings.ReplaceAll(role, "/", "_")
+}
+
+// List returns the pending changes in the order they were added.
+func (cl *Changelist) List() ([]Change, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.list()
+}
+
+func (cl *Changelist) list() ([]Change, error) {
+	files, err := ioutil.ReadDir(cl.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "changelist: read directory")
+	}
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		if !f.IsDir() && filepath.Ext(f.Name()) == ".change" {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+
+	changes := make([]Change, 0, len(names))
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(cl.dir, name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "changelist: read change %q", name)
+		}
+		var c Change
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, errors.Wrapf(err, "changelist: unmarshal change %q", name)
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// Clear removes every pending change, typically called after a successful
+// publish.
+func (cl *Changelist) Clear() error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	entries, err := ioutil.ReadDir(cl.dir)
+	if err != nil {
+		return errors.Wrap(err, "changelist: read directory")
+	}
+	for _, f := range entries {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".change" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(cl.dir, f.Name())); err != nil {
+			return errors.Wrapf(err, "changelist: remove change %q", f.Name())
+		}
+	}
+	return nil
+}
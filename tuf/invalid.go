@@ -0,0 +1,59 @@
+package tuf
+
+import "sync"
+
+// invalidRepo collects delegated roles whose signatures, expiry, or
+// thresholds failed verification but whose JSON parsed cleanly, mirroring
+// notary's NotaryRepository.invalid field. Recording these separately lets
+// the tree walk continue past a single bad delegation instead of aborting
+// the whole update, and lets a subsequent publish/witness flow re-sign the
+// offending role without a full re-bootstrap.
+type invalidRepo struct {
+	mu    sync.Mutex
+	roles map[string]*Targets
+}
+
+func newInvalidRepo() *invalidRepo {
+	return &invalidRepo{roles: make(map[string]*Targets)}
+}
+
+func (i *invalidRepo) record(roleName string, targ *Targets) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.roles[roleName] = targ
+}
+
+func (i *invalidRepo) snapshot() map[string]*Targets {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	out := make(map[string]*Targets, len(i.roles))
+	for k, v := range i.roles {
+		out[k] = v
+	}
+	return out
+}
+
+// Invalid returns the delegated roles that failed signature, expiry, or
+// threshold verification during the last tree walk, keyed by role name. A
+// role recorded here parsed as valid JSON but was not trusted.
+func (t *RootTarget) Invalid() map[string]*Targets {
+	if t.invalid == nil {
+		return map[string]*Targets{}
+	}
+	return t.invalid.snapshot()
+}
+
+// errInvalidMetadata distinguishes a terminal verification failure (bad
+// signature, expired metadata, threshold not met) on an otherwise
+// well-formed role from a hard fetch/transport error. A roleFetcher that
+// parsed a role but could not verify it should return this alongside the
+// parsed *Targets so the failure can be recorded instead of propagated;
+// only hard fetch/transport errors and cycles should abort the tree walk.
+type errInvalidMetadata struct {
+	role role
+	err  error
+}
+
+func (e errInvalidMetadata) Error() string {
+	return "invalid metadata for role " + string(e.role) + ": " + e.err.Error()
+}
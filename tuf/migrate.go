@@ -0,0 +1,174 @@
+package tuf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	layoutMarkerFile = "layout.json"
+	metadataDir      = "metadata"
+
+	// currentLayoutVersion is the on-disk localRepo layout this package
+	// reads and writes. Bump it, and add a migration step to
+	// migrateLocalRepo, whenever the layout changes.
+	currentLayoutVersion = 1
+)
+
+// repoLayout is the contents of a localRepo's metadata/layout.json marker.
+type repoLayout struct {
+	Version int `json:"version"`
+}
+
+// LayoutVersion returns the on-disk layout version of the repo, or 0 for a
+// legacy repo that has not yet been migrated.
+func (r localRepo) LayoutVersion() int {
+	layout, err := readLayout(r.repoPath)
+	if err != nil {
+		return 0
+	}
+	return layout.Version
+}
+
+func readLayout(repoPath string) (*repoLayout, error) {
+	data, err := ioutil.ReadFile(filepath.Join(repoPath, metadataDir, layoutMarkerFile))
+	if err != nil {
+		return nil, err
+	}
+	var layout repoLayout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return nil, errors.Wrap(err, "parse layout marker")
+	}
+	return &layout, nil
+}
+
+// migrateLocalRepo detects a legacy on-disk layout at repoPath and rewrites
+// it into the current versioned layout: a metadata/ subdir holding both the
+// role JSON files and a layout.json marker recording the version. The
+// marker lives inside metadata/, alongside the files it describes, so the
+// entire new layout is staged as a single temp directory and lands with one
+// os.Rename: repoPath observes either the untouched legacy layout or the
+// fully migrated one, never a metadata/ dir with no marker or a partial set
+// of files. It is a no-op on a repo already at currentLayoutVersion, and it
+// refuses to open a repo whose layout is newer than this package supports.
+// repoPath may be a symlink to the real repo directory; Stat/Glob/Rename all
+// resolve through it transparently.
+func migrateLocalRepo(repoPath string) error {
+	layout, err := readLayout(repoPath)
+	if err == nil {
+		if layout.Version > currentLayoutVersion {
+			return errors.Errorf("tuf repo layout version %d is newer than supported version %d", layout.Version, currentLayoutVersion)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return errors.Wrap(err, "read layout marker")
+	}
+
+	legacy, err := detectLegacyLayout(repoPath)
+	if err != nil {
+		return err
+	}
+	return stageMetadata(repoPath, legacy)
+}
+
+// legacyFiles maps a destination metadata/ filename to the absolute path of
+// the legacy file it was found at. A nil/empty legacyFiles means repoPath is
+// a brand-new repo with nothing to carry over.
+type legacyFiles map[string]string
+
+// detectLegacyLayout looks for the two layouts this package knows how to
+// migrate: a flat set of *.json files at the repo root, and the older
+// tuf/<gun>/metadata/*.json nesting used by early Notary clients. It
+// returns a nil legacyFiles when neither is present.
+func detectLegacyLayout(repoPath string) (legacyFiles, error) {
+	flat, err := filepath.Glob(filepath.Join(repoPath, "*.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "glob legacy flat metadata")
+	}
+	if len(flat) > 0 {
+		return legacyFilesFrom(flat), nil
+	}
+
+	nested, err := filepath.Glob(filepath.Join(repoPath, "tuf", "*", "metadata", "*.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "glob legacy nested metadata")
+	}
+	if len(nested) > 0 {
+		return legacyFilesFrom(nested), nil
+	}
+
+	return nil, nil
+}
+
+func legacyFilesFrom(paths []string) legacyFiles {
+	files := make(legacyFiles, len(paths))
+	for _, p := range paths {
+		files[filepath.Base(p)] = p
+	}
+	return files
+}
+
+// stageMetadata builds the complete new metadata/ directory - legacy role
+// files (if any) plus the layout.json marker - in a temp directory, then
+// moves it into place with a single os.Rename so the marker and the files
+// it describes always land together. Legacy source files are only removed
+// after that rename succeeds, so a crash before it leaves the legacy layout
+// untouched for a retry, and a crash after it leaves a fully migrated repo;
+// there is no rename ordering to crash between.
+func stageMetadata(repoPath string, legacy legacyFiles) error {
+	tmp, err := ioutil.TempDir(repoPath, ".metadata-")
+	if err != nil {
+		return errors.Wrap(err, "create migration temp dir")
+	}
+	defer os.RemoveAll(tmp)
+
+	for name, src := range legacy {
+		fi, err := os.Stat(src)
+		if err != nil {
+			return errors.Wrapf(err, "stat %q", src)
+		}
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			return errors.Wrapf(err, "read %q", src)
+		}
+		if err := ioutil.WriteFile(filepath.Join(tmp, name), data, fi.Mode()); err != nil {
+			return errors.Wrapf(err, "write %q", name)
+		}
+	}
+	if err := writeLayoutMarkerTo(tmp); err != nil {
+		return err
+	}
+
+	finalMetadata := filepath.Join(repoPath, metadataDir)
+	// A stale, marker-less metadata dir here was never a valid layout
+	// (readLayout would have returned above if it were), so it's safe to
+	// discard before the rename that replaces it - most likely leftover
+	// from interference outside this package, since a crash during our
+	// own migration never produces one.
+	if err := os.RemoveAll(finalMetadata); err != nil {
+		return errors.Wrap(err, "clear stale destination metadata dir")
+	}
+	if err := os.Rename(tmp, finalMetadata); err != nil {
+		return errors.Wrap(err, "rename metadata dir into place")
+	}
+
+	for _, src := range legacy {
+		// Best-effort cleanup of the legacy files; the repo is already
+		// valid under the new layout at this point.
+		os.Remove(src)
+	}
+	return nil
+}
+
+func writeLayoutMarkerTo(dir string) error {
+	data, err := json.Marshal(repoLayout{Version: currentLayoutVersion})
+	if err != nil {
+		return errors.Wrap(err, "marshal layout marker")
+	}
+	return ioutil.WriteFile(filepath.Join(dir, layoutMarkerFile), data, 0644)
+}
@@ -0,0 +1,161 @@
+package tuf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path string, data []byte, mode os.FileMode) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, data, mode); err != nil {
+		t.Fatalf("write %q: %v", path, err)
+	}
+}
+
+func TestMigrateLocalRepoFlatLegacy(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "root.json"), []byte(`{"role":"root"}`), 0600)
+	writeTestFile(t, filepath.Join(dir, "targets.json"), []byte(`{"role":"targets"}`), 0644)
+
+	if err := migrateLocalRepo(dir); err != nil {
+		t.Fatalf("migrateLocalRepo: %v", err)
+	}
+
+	for _, name := range []string{"root.json", "targets.json"} {
+		if _, err := os.Stat(filepath.Join(dir, metadataDir, name)); err != nil {
+			t.Fatalf("expected migrated %q: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected legacy %q to be removed, err=%v", name, err)
+		}
+	}
+
+	if v := (localRepo{repoPath: dir}).LayoutVersion(); v != currentLayoutVersion {
+		t.Fatalf("LayoutVersion = %d, want %d", v, currentLayoutVersion)
+	}
+}
+
+func TestMigrateLocalRepoNestedLegacy(t *testing.T) {
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "tuf", "example.com-repo", "metadata")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(nested, "snapshot.json"), []byte(`{"role":"snapshot"}`), 0600)
+
+	if err := migrateLocalRepo(dir); err != nil {
+		t.Fatalf("migrateLocalRepo: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, metadataDir, "snapshot.json")); err != nil {
+		t.Fatalf("expected migrated snapshot.json: %v", err)
+	}
+}
+
+func TestMigrateLocalRepoNewRepoNoLegacy(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := migrateLocalRepo(dir); err != nil {
+		t.Fatalf("migrateLocalRepo: %v", err)
+	}
+	if v := (localRepo{repoPath: dir}).LayoutVersion(); v != currentLayoutVersion {
+		t.Fatalf("LayoutVersion = %d, want %d", v, currentLayoutVersion)
+	}
+}
+
+func TestMigrateLocalRepoIdempotent(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "root.json"), []byte(`{"role":"root"}`), 0600)
+
+	if err := migrateLocalRepo(dir); err != nil {
+		t.Fatalf("first migrateLocalRepo: %v", err)
+	}
+	first, err := ioutil.ReadFile(filepath.Join(dir, metadataDir, layoutMarkerFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateLocalRepo(dir); err != nil {
+		t.Fatalf("second migrateLocalRepo: %v", err)
+	}
+	second, err := ioutil.ReadFile(filepath.Join(dir, metadataDir, layoutMarkerFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(first) != string(second) {
+		t.Fatalf("layout marker changed across an idempotent re-run: %q != %q", first, second)
+	}
+	if _, err := os.Stat(filepath.Join(dir, metadataDir, "root.json")); err != nil {
+		t.Fatalf("expected root.json to still be present: %v", err)
+	}
+}
+
+func TestMigrateLocalRepoRefusesNewerLayout(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, metadataDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(repoLayout{Version: currentLayoutVersion + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, metadataDir, layoutMarkerFile), data, 0644)
+
+	if err := migrateLocalRepo(dir); err == nil {
+		t.Fatal("expected migrateLocalRepo to refuse a newer-than-supported layout version")
+	}
+}
+
+// TestMigrateLocalRepoPartialCrashRecovery simulates a crash that left a
+// stale, marker-less metadata/ dir behind (e.g. from manual interference, or
+// a layout this package no longer produces): since such a dir was never a
+// valid layout, a subsequent migration should discard it and re-migrate from
+// the still-present legacy files rather than getting stuck.
+func TestMigrateLocalRepoPartialCrashRecovery(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "root.json"), []byte(`{"role":"root"}`), 0600)
+
+	stale := filepath.Join(dir, metadataDir)
+	if err := os.MkdirAll(stale, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(stale, "garbage"), []byte("leftover"), 0600)
+
+	if err := migrateLocalRepo(dir); err != nil {
+		t.Fatalf("migrateLocalRepo: %v", err)
+	}
+
+	if v := (localRepo{repoPath: dir}).LayoutVersion(); v != currentLayoutVersion {
+		t.Fatalf("LayoutVersion = %d, want %d", v, currentLayoutVersion)
+	}
+	if _, err := os.Stat(filepath.Join(stale, "garbage")); !os.IsNotExist(err) {
+		t.Fatalf("expected stale garbage file to be cleared, err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(stale, "root.json")); err != nil {
+		t.Fatalf("expected root.json to be migrated: %v", err)
+	}
+}
+
+func TestMigrateLocalRepoSymlinkedPath(t *testing.T) {
+	real := t.TempDir()
+	writeTestFile(t, filepath.Join(real, "targets.json"), []byte(`{"role":"targets"}`), 0600)
+
+	parent := t.TempDir()
+	link := filepath.Join(parent, "repo")
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateLocalRepo(link); err != nil {
+		t.Fatalf("migrateLocalRepo via symlink: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(real, metadataDir, "targets.json")); err != nil {
+		t.Fatalf("expected migrated file in the real directory: %v", err)
+	}
+	if v := (localRepo{repoPath: link}).LayoutVersion(); v != currentLayoutVersion {
+		t.Fatalf("LayoutVersion via symlink = %d, want %d", v, currentLayoutVersion)
+	}
+}
@@ -0,0 +1,309 @@
+package tuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/aivaturi/updater/tuf/changelist"
+	"github.com/aivaturi/updater/tuf/signed"
+)
+
+// tufRepo is the in-memory bundle of currently-loaded metadata that publish
+// mutates before re-signing and uploading.
+type tufRepo struct {
+	root      *Root
+	targets   *RootTarget
+	snapshot  *Snapshot
+	timestamp *Timestamp
+}
+
+// Signature is a single role signature in the form Notary's upload format
+// expects.
+type Signature struct {
+	KeyID     string `json:"keyid"`
+	Method    string `json:"method"`
+	Signature []byte `json:"sig"`
+}
+
+// signable is implemented by Root, Targets, Snapshot, and Timestamp: the
+// canonical bytes to sign, the key IDs authorized to sign this role, and a
+// place to record the resulting signatures.
+type signable interface {
+	signedBytes() ([]byte, error)
+	roleKeyIDs() []string
+	setSignatures(sigs []Signature)
+}
+
+// publish applies the pending changes in cl to the in-memory tufRepo,
+// re-signs every role the changes touched (plus root when a root-role
+// change is pending, and snapshot/timestamp always, since their versions
+// bump on every publish), and uploads the result to Notary's batch update
+// endpoint. On success cl is cleared.
+func (r *notaryRepo) publish(cl *changelist.Changelist) error {
+	changes, err := cl.List()
+	if err != nil {
+		return errors.Wrap(err, "publish: load changelist")
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	current, err := r.loadForPublish()
+	if err != nil {
+		return errors.Wrap(err, "publish: load current metadata")
+	}
+
+	touchedTargets := make(map[string]struct{})
+	rootTouched := false
+	for _, c := range changes {
+		if err := applyChange(current, c); err != nil {
+			return errors.Wrapf(err, "publish: apply change to %q", c.Role)
+		}
+		switch {
+		case c.Scope == changelist.ScopeRootRole:
+			rootTouched = true
+		case c.Scope == changelist.ScopeWitness && c.Role == string(roleRoot):
+			// A witness for the root role itself has no entry in
+			// targetLookup, so it must go through the rootTouched
+			// path rather than touchedTargets or it would silently
+			// be dropped.
+			rootTouched = true
+		default:
+			touchedTargets[c.Role] = struct{}{}
+		}
+	}
+
+	if err := r.resignRoles(current, touchedTargets, rootTouched); err != nil {
+		return errors.Wrap(err, "publish: re-sign roles")
+	}
+	bumpSnapshotAndTimestamp(current)
+
+	if err := r.upload(current, touchedTargets, rootTouched); err != nil {
+		return errors.Wrap(err, "publish: upload")
+	}
+	return cl.Clear()
+}
+
+// loadForPublish fetches the roles publish needs a current view of before
+// applying pending changes.
+func (r *notaryRepo) loadForPublish() (*tufRepo, error) {
+	root, err := r.root()
+	if err != nil {
+		return nil, err
+	}
+	targets, err := r.targets(r)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := r.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := r.timestamp()
+	if err != nil {
+		return nil, err
+	}
+	return &tufRepo{root: root, targets: targets, snapshot: snapshot, timestamp: timestamp}, nil
+}
+
+// fetch makes notaryRepo usable as the roleFetcher passed to targets(),
+// fetching a single delegated role over the same transport root() and
+// snapshot() use.
+func (r *notaryRepo) fetch(roleName string) (*Targets, error) {
+	return r.fetchTargetsRole(roleName)
+}
+
+// applyChange mutates the in-memory tufRepo according to a single
+// changelist entry. A witness change (changelist.ScopeWitness) requires
+// no content mutation: the role is simply marked touched so resignRoles
+// re-signs it at its current version. A witnessed role held only in the
+// tree's invalid set is brought into targetLookup so it is re-signed and
+// uploaded like any other touched role.
+func applyChange(repo *tufRepo, c changelist.Change) error {
+	switch c.Scope {
+	case changelist.ScopeWitness:
+		if _, ok := repo.targets.targetLookup[c.Role]; !ok {
+			if targ, ok := repo.targets.Invalid()[c.Role]; ok {
+				repo.targets.targetLookup[c.Role] = targ
+			}
+		}
+		return nil
+	case changelist.ScopeTargets, changelist.ScopeDelegations:
+		return applyTargetsChange(repo, c)
+	case changelist.ScopeRootRole:
+		return applyRootRoleChange(repo, c)
+	default:
+		return errors.Errorf("publish: unknown change scope %q", c.Scope)
+	}
+}
+
+func applyTargetsChange(repo *tufRepo, c changelist.Change) error {
+	targ, ok := repo.targets.targetLookup[c.Role]
+	if !ok {
+		return errors.Errorf("publish: role %q is not loaded", c.Role)
+	}
+	switch c.Action {
+	case changelist.ActionDelete:
+		delete(targ.Signed.Targets, c.Path)
+	case changelist.ActionCreate, changelist.ActionUpdate:
+		var fim FIM
+		if err := json.Unmarshal(c.Content, &fim); err != nil {
+			return errors.Wrap(err, "publish: unmarshal target content")
+		}
+		targ.Signed.Targets[c.Path] = fim
+	default:
+		return errors.Errorf("publish: unknown change action %q", c.Action)
+	}
+	return nil
+}
+
+func applyRootRoleChange(repo *tufRepo, c changelist.Change) error {
+	var rootRole RootRole
+	if err := json.Unmarshal(c.Content, &rootRole); err != nil {
+		return errors.Wrap(err, "publish: unmarshal root role content")
+	}
+	repo.root.Signed.Roles[role(c.Role)] = &rootRole
+	return nil
+}
+
+// resignRoles re-signs every role in touchedTargets, root when rootTouched,
+// and snapshot/timestamp (which always re-sign, since their versions bump
+// on every publish), using the repo's configured CryptoService.
+func (r *notaryRepo) resignRoles(repo *tufRepo, touchedTargets map[string]struct{}, rootTouched bool) error {
+	svc := r.cryptoService
+	if svc == nil {
+		return errors.New("publish: no CryptoService configured")
+	}
+	for roleName := range touchedTargets {
+		targ, ok := repo.targets.targetLookup[roleName]
+		if !ok {
+			continue
+		}
+		if err := signRole(svc, targ); err != nil {
+			return errors.Wrapf(err, "re-sign %q", roleName)
+		}
+	}
+	if rootTouched {
+		if err := signRole(svc, repo.root); err != nil {
+			return errors.Wrap(err, "re-sign root")
+		}
+	}
+	if err := signRole(svc, repo.snapshot); err != nil {
+		return errors.Wrap(err, "re-sign snapshot")
+	}
+	if err := signRole(svc, repo.timestamp); err != nil {
+		return errors.Wrap(err, "re-sign timestamp")
+	}
+	return nil
+}
+
+// signRole signs meta's canonical signed content with every key authorized
+// for its role that svc holds, and records the resulting signatures on meta.
+// Authorized keys that svc does not return are skipped; it fails only when
+// none of them are available.
+func signRole(svc signed.CryptoService, meta signable) error {
+	msg, err := meta.signedBytes()
+	if err != nil {
+		return errors.Wrap(err, "canonicalize signed content")
+	}
+
+	keyIDs := meta.roleKeyIDs()
+	if len(keyIDs) == 0 {
+		return errors.New("no keys are authorized to sign this role")
+	}
+	keys, err := svc.PublicKeys(keyIDs...)
+	if err != nil {
+		return errors.Wrap(err, "load signing keys")
+	}
+
+	sigs := make([]Signature, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		key, ok := keys[keyID]
+		if !ok {
+			continue
+		}
+		sig, err := svc.Sign(keyID, msg)
+		if err != nil {
+			return errors.Wrapf(err, "sign with key %q", keyID)
+		}
+		sigs = append(sigs, Signature{KeyID: keyID, Method: key.Algorithm(), Signature: sig})
+	}
+	if len(sigs) == 0 {
+		return errors.New("none of the role's authorized keys are available to sign")
+	}
+
+	meta.setSignatures(sigs)
+	return nil
+}
+
+func bumpSnapshotAndTimestamp(repo *tufRepo) {
+	repo.snapshot.Signed.Version++
+	repo.timestamp.Signed.Version++
+}
+
+// upload POSTs the touched roles (root when rootTouched, plus snapshot and
+// timestamp) as a multipart request to Notary's batch metadata update
+// endpoint.
+func (r *notaryRepo) upload(repo *tufRepo, touchedTargets map[string]struct{}, rootTouched bool) error {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	write := func(roleName string, meta interface{}) error {
+		data, err := json.Marshal(meta)
+		if err != nil {
+			return errors.Wrapf(err, "marshal %q", roleName)
+		}
+		part, err := writer.CreateFormFile(roleName, roleName+".json")
+		if err != nil {
+			return err
+		}
+		_, err = part.Write(data)
+		return err
+	}
+
+	for roleName := range touchedTargets {
+		targ, ok := repo.targets.targetLookup[roleName]
+		if !ok {
+			continue
+		}
+		if err := write(roleName, targ); err != nil {
+			return err
+		}
+	}
+	if rootTouched {
+		if err := write(string(roleRoot), repo.root); err != nil {
+			return err
+		}
+	}
+	if err := write(string(roleSnapshot), repo.snapshot); err != nil {
+		return err
+	}
+	if err := write(string(roleTimestamp), repo.timestamp); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s://%s/v2/%s/_trust/tuf/", tufURLScheme, r.url.Host, r.gun)
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "publish: upload request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return errors.Errorf("publish: notary server returned %d", resp.StatusCode)
+	}
+	return nil
+}
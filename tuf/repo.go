@@ -7,6 +7,9 @@ import (
 	"regexp"
 
 	"github.com/pkg/errors"
+
+	"github.com/aivaturi/updater/tuf/changelist"
+	"github.com/aivaturi/updater/tuf/signed"
 )
 
 const (
@@ -69,6 +72,10 @@ type repo interface {
 type remoteRepo interface {
 	repo
 	ping() error
+	// publish applies the pending changes in cl, re-signs the affected
+	// roles, bumps snapshot/timestamp versions, and uploads the result to
+	// Notary.
+	publish(cl *changelist.Changelist) error
 }
 
 type persistentRepo interface {
@@ -87,6 +94,8 @@ type notaryRepo struct {
 	gun             string
 	maxResponseSize int64
 	client          *http.Client
+	trustPin        TrustPinConfig
+	cryptoService   signed.CryptoService
 }
 
 func newLocalRepo(repoPath string) (*localRepo, error) {
@@ -95,6 +104,9 @@ func newLocalRepo(repoPath string) (*localRepo, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "new tuf repo")
 	}
+	if err := migrateLocalRepo(repoPath); err != nil {
+		return nil, errors.Wrap(err, "new tuf repo")
+	}
 	repo := localRepo{
 		repoPath: repoPath,
 	}
@@ -102,11 +114,13 @@ func newLocalRepo(repoPath string) (*localRepo, error) {
 	return &repo, nil
 }
 
-func newNotaryRepo(settings *Settings, maxResponseSize int64, client *http.Client) (*notaryRepo, error) {
+func newNotaryRepo(settings *Settings, maxResponseSize int64, client *http.Client, trustPin TrustPinConfig, cryptoService signed.CryptoService) (*notaryRepo, error) {
 	r := &notaryRepo{
 		maxResponseSize: maxResponseSize,
 		gun:             settings.GUN,
 		client:          client,
+		trustPin:        trustPin,
+		cryptoService:   cryptoService,
 	}
 	var err error
 	// TODO remove, already validated in settings.verify
@@ -117,6 +131,14 @@ func newNotaryRepo(settings *Settings, maxResponseSize int64, client *http.Clien
 	return r, nil
 }
 
+// enforceTrustPinning validates a freshly fetched root against the repo's
+// configured TrustPinConfig before it is persisted. It must be called by
+// root() prior to writing the new root to local storage; a non-nil error
+// means the root must be discarded rather than trusted.
+func (r *notaryRepo) enforceTrustPinning(rootKeyIDs []string, rootCerts [][]byte) error {
+	return checkTrustPinning(r.trustPin, r.gun, rootKeyIDs, rootCerts)
+}
+
 func validateURL(repoURL string) (*url.URL, error) {
 	u, err := url.Parse(repoURL)
 	if err != nil {
@@ -194,6 +216,7 @@ func targetTreeBuilder(fetcher roleFetcher) (*RootTarget, error) {
 		Targets:      targ,
 		paths:        make(FimMap),
 		targetLookup: make(map[string]*Targets),
+		invalid:      newInvalidRepo(),
 	}
 	root.append(string(roleTargets), targ)
 
@@ -209,6 +232,14 @@ func targetTreeBuilder(fetcher roleFetcher) (*RootTarget, error) {
 func getDelegatedTarget(fetcher roleFetcher, root *RootTarget, roleName string) error {
 	target, err := fetcher.fetch(roleName)
 	if err != nil {
+		// A role that parsed but failed signature/expiry/threshold
+		// verification is recorded as invalid and the traversal
+		// continues for sibling delegations; only hard fetch/transport
+		// errors abort the walk.
+		if _, ok := errors.Cause(err).(errInvalidMetadata); ok && target != nil {
+			root.invalid.record(roleName, target)
+			return nil
+		}
 		return err
 	}
 	root.append(roleName, target)
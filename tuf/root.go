@@ -0,0 +1,42 @@
+package tuf
+
+import "github.com/pkg/errors"
+
+// root fetches the root role from Notary and enforces the repo's configured
+// TrustPinConfig before persisting it. This is the path TrustPinConfig
+// exists to protect: a root that fails pinning is returned as an error and
+// never written to local storage, rather than being trusted on first use.
+func (r *notaryRepo) root(opts ...repoOption) (*Root, error) {
+	root, err := r.fetchRoot(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch root")
+	}
+
+	rootRole, ok := root.Signed.Roles[roleRoot]
+	if !ok {
+		return nil, errors.New("root metadata has no root role")
+	}
+	if err := r.enforceTrustPinning(rootRole.KeyIDs, rootCertsFromKeys(root, rootRole.KeyIDs)); err != nil {
+		return nil, err
+	}
+
+	if err := r.persistRoot(root); err != nil {
+		return nil, errors.Wrap(err, "persist root")
+	}
+	return root, nil
+}
+
+// rootCertsFromKeys collects the raw public key bytes backing keyIDs from
+// root's key store. Every key found is included, whether or not it carries
+// an X.509 certificate; rootChainsToCA skips entries that do not parse as one.
+func rootCertsFromKeys(root *Root, keyIDs []string) [][]byte {
+	certs := make([][]byte, 0, len(keyIDs))
+	for _, id := range keyIDs {
+		key, ok := root.Signed.Keys[id]
+		if !ok {
+			continue
+		}
+		certs = append(certs, key.Public())
+	}
+	return certs
+}
@@ -0,0 +1,25 @@
+// Package signed abstracts the key storage and signing operations needed to
+// produce valid TUF signatures, so that publish can be backed by a local
+// keystore, an HSM, or a remote signer interchangeably.
+package signed
+
+// PublicKey is the minimal public key representation a CryptoService
+// exchanges with callers.
+type PublicKey interface {
+	ID() string
+	Algorithm() string
+	Public() []byte
+}
+
+// CryptoService signs content on behalf of a role during publish, without
+// the caller needing to know where or how the corresponding private key is
+// stored.
+type CryptoService interface {
+	// Sign returns a signature over msg using the private key identified
+	// by keyID.
+	Sign(keyID string, msg []byte) ([]byte, error)
+
+	// PublicKeys returns the public keys available for the given key
+	// IDs, keyed by key ID.
+	PublicKeys(keyIDs ...string) (map[string]PublicKey, error)
+}
@@ -0,0 +1,81 @@
+package tuf
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// errTargetNotFoundInRoles is returned by LookupTarget when none of the
+// requested roles contain a valid entry for the target name.
+type errTargetNotFoundInRoles struct {
+	name  string
+	roles []role
+}
+
+func (e errTargetNotFoundInRoles) Error() string {
+	names := make([]string, len(e.roles))
+	for i, r := range e.roles {
+		names[i] = string(r)
+	}
+	return errors.Errorf("target %q not found in roles %s", e.name, strings.Join(names, ", ")).Error()
+}
+
+// validateLookupRole restricts role search order entries to targets itself
+// or a targets/* delegation, mirroring the roles a LookupTarget caller may
+// legitimately prioritize.
+func validateLookupRole(r role) error {
+	if r == roleTargets || strings.HasPrefix(string(r), string(roleTargets)+"/") {
+		return nil
+	}
+	return errors.Errorf("%q is not %q or a %q delegation", r, roleTargets, string(roleTargets)+"/*")
+}
+
+// targetTreeBuilderWithRoles builds the full delegation tree exactly like
+// targetTreeBuilder, but first validates roles as a preferred search order
+// so that a later RootTarget.LookupTarget call with no explicit roles can
+// reuse it.
+func targetTreeBuilderWithRoles(fetcher roleFetcher, roles ...role) (*RootTarget, error) {
+	for _, r := range roles {
+		if err := validateLookupRole(r); err != nil {
+			return nil, errors.Wrap(err, "target tree builder")
+		}
+	}
+	root, err := targetTreeBuilder(fetcher)
+	if err != nil {
+		return nil, err
+	}
+	root.preferredRoles = roles
+	return root, nil
+}
+
+// LookupTarget returns the FIM for name from the first role in roles that
+// contains a valid entry, in the order given, regardless of the underlying
+// tree's DFS order. If roles is empty, the preferred role order recorded by
+// targetTreeBuilderWithRoles is used instead, falling back to targets alone.
+//
+// This mirrors notary's NotaryRepository.GetTargetByName(name, roleList...),
+// which lets a "releases"-style delegation take precedence over targets
+// even though targets is always visited first during the DFS walk.
+func (t *RootTarget) LookupTarget(name string, roles ...role) (*FIM, role, error) {
+	if len(roles) == 0 {
+		roles = t.preferredRoles
+	}
+	if len(roles) == 0 {
+		roles = []role{roleTargets}
+	}
+
+	for _, r := range roles {
+		if err := validateLookupRole(r); err != nil {
+			return nil, "", err
+		}
+		targ, ok := t.targetLookup[string(r)]
+		if !ok {
+			continue
+		}
+		if fim, ok := targ.Signed.Targets[name]; ok {
+			return &fim, r, nil
+		}
+	}
+	return nil, "", errTargetNotFoundInRoles{name: name, roles: roles}
+}
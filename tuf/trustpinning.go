@@ -0,0 +1,176 @@
+package tuf
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TrustPinConfig constrains which root keys or certificate authorities are
+// acceptable when bootstrapping trust for a GUN, instead of relying solely
+// on trust-on-first-use (TOFU).
+//
+// Entries are keyed by GUN or GUN glob (e.g. "docker.io/*"); the most
+// specific matching entry wins. A GUN with no matching entry falls back to
+// TOFU unless DisableTOFU is set.
+type TrustPinConfig struct {
+	// CertIDs pins a GUN to an explicit set of root key IDs (SHA-256
+	// fingerprints of a root public key, as found in
+	// Root.Signed.Roles[roleRoot].KeyIDs).
+	CertIDs map[string][]string
+
+	// CA pins a GUN to a CA certificate bundle (PEM-encoded); a root
+	// certificate must chain to a certificate in this bundle to be
+	// accepted.
+	CA map[string]string
+
+	// DisableTOFU rejects any GUN with no matching CertIDs or CA entry,
+	// rather than trusting whatever root is fetched on first use.
+	DisableTOFU bool
+}
+
+// errRootPinningFailure is returned when a freshly fetched root does not
+// satisfy the configured TrustPinConfig.
+type errRootPinningFailure struct {
+	gun    string
+	reason string
+}
+
+func (e errRootPinningFailure) Error() string {
+	return fmt.Sprintf("tuf: trust pinning rejected root for %q: %s", e.gun, e.reason)
+}
+
+// trustPinCandidate is the best match found so far while scanning both the
+// CertIDs and CA entries of a TrustPinConfig. Tracking certIDs and ca on the
+// same candidate (rather than as two independently-tracked "best" values)
+// ensures only the single most specific pattern's kind of pin ever wins,
+// even when a CertIDs glob and a more specific CA entry both match the GUN.
+type trustPinCandidate struct {
+	pattern string
+	certIDs []string
+	ca      string
+}
+
+// matchTrustPin finds the most specific GUN-glob entry in cfg that matches
+// gun, returning either its pinned cert IDs or its pinned CA bundle
+// (whichever kind that entry was), never both.
+func matchTrustPin(cfg TrustPinConfig, gun string) (certIDs []string, ca string, matched bool) {
+	var best *trustPinCandidate
+	consider := func(pattern string, ids []string, caBundle string) {
+		if len(ids) == 0 && caBundle == "" {
+			return
+		}
+		if !gunGlobMatch(pattern, gun) {
+			return
+		}
+		if best == nil || len(pattern) > len(best.pattern) {
+			best = &trustPinCandidate{pattern: pattern, certIDs: ids, ca: caBundle}
+		}
+	}
+	for pattern, ids := range cfg.CertIDs {
+		consider(pattern, ids, "")
+	}
+	for pattern, bundle := range cfg.CA {
+		consider(pattern, nil, bundle)
+	}
+	if best == nil {
+		return nil, "", false
+	}
+	return best.certIDs, best.ca, true
+}
+
+// gunGlobMatch reports whether pattern matches gun, where a trailing "*"
+// matches any suffix including further "/"-separated segments (e.g.
+// "docker.io/*" matches both "docker.io/alpine" and
+// "docker.io/library/alpine"). GUNs are multi-segment, so a segment-scoped
+// matcher like path.Match's would silently fail to match the common case.
+func gunGlobMatch(pattern, gun string) bool {
+	if pattern == gun {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(gun, strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
+
+// checkTrustPinning enforces cfg against a newly fetched root for gun before
+// it is persisted. rootKeyIDs are the key IDs listed under
+// Root.Signed.Roles[roleRoot].KeyIDs; rootCerts are the PEM- or DER-encoded
+// certificates backing those keys, when present.
+func checkTrustPinning(cfg TrustPinConfig, gun string, rootKeyIDs []string, rootCerts [][]byte) error {
+	certIDs, caBundle, matched := matchTrustPin(cfg, gun)
+	if !matched {
+		if cfg.DisableTOFU {
+			return errRootPinningFailure{gun: gun, reason: "trust-on-first-use is disabled and no pin matches this GUN"}
+		}
+		return nil
+	}
+
+	if len(certIDs) > 0 {
+		if !anyKeyIDPinned(certIDs, rootKeyIDs) {
+			return errRootPinningFailure{gun: gun, reason: "root key IDs do not match any pinned certificate ID"}
+		}
+		return nil
+	}
+
+	if caBundle != "" {
+		if err := rootChainsToCA(rootCerts, caBundle); err != nil {
+			return errRootPinningFailure{gun: gun, reason: err.Error()}
+		}
+		return nil
+	}
+
+	return nil
+}
+
+func anyKeyIDPinned(pinned, actual []string) bool {
+	pin := make(map[string]struct{}, len(pinned))
+	for _, id := range pinned {
+		pin[id] = struct{}{}
+	}
+	for _, id := range actual {
+		if _, ok := pin[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rootChainsToCA verifies that at least one certificate in certs chains to a
+// certificate in the PEM-encoded caBundle.
+func rootChainsToCA(certs [][]byte, caBundle string) error {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caBundle)) {
+		return errors.New("pinned CA bundle contains no usable certificates")
+	}
+
+	for _, der := range certs {
+		cert, err := parsePossiblyPEMCert(der)
+		if err != nil {
+			continue
+		}
+		if _, err := cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err == nil {
+			return nil
+		}
+	}
+	return errors.New("root certificate does not chain to any pinned CA")
+}
+
+func parsePossiblyPEMCert(raw []byte) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(raw); block != nil {
+		raw = block.Bytes
+	}
+	return x509.ParseCertificate(raw)
+}
+
+// fingerprint returns the SHA-256 fingerprint of a DER-encoded public key,
+// in the same form used for Root.Signed.Roles[roleRoot].KeyIDs.
+func fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return fmt.Sprintf("%x", sum)
+}
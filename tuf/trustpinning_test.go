@@ -0,0 +1,104 @@
+package tuf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func selfSignedCA(t *testing.T, cn string) (der []byte, pemBytes []byte) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err = x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return der, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCheckTrustPinningFingerprintMatch(t *testing.T) {
+	cfg := TrustPinConfig{CertIDs: map[string][]string{"docker.io/alpine": {"aaaa", "bbbb"}}}
+
+	if err := checkTrustPinning(cfg, "docker.io/alpine", []string{"zzzz", "bbbb"}, nil); err != nil {
+		t.Fatalf("expected pinned fingerprint to match, got: %v", err)
+	}
+	if err := checkTrustPinning(cfg, "docker.io/alpine", []string{"zzzz"}, nil); err == nil {
+		t.Fatal("expected unpinned fingerprint to be rejected")
+	}
+}
+
+func TestCheckTrustPinningCAChainMatch(t *testing.T) {
+	_, pinnedPEM := selfSignedCA(t, "pinned-ca")
+	otherDER, _ := selfSignedCA(t, "other-ca")
+
+	trustedDER, _ := pem.Decode(pinnedPEM)
+	cfg := TrustPinConfig{CA: map[string]string{"docker.io/alpine": string(pinnedPEM)}}
+
+	if err := checkTrustPinning(cfg, "docker.io/alpine", nil, [][]byte{trustedDER.Bytes}); err != nil {
+		t.Fatalf("expected root cert to chain to pinned CA, got: %v", err)
+	}
+	if err := checkTrustPinning(cfg, "docker.io/alpine", nil, [][]byte{otherDER}); err == nil {
+		t.Fatal("expected root cert from an unrelated CA to be rejected")
+	}
+}
+
+func TestCheckTrustPinningWildcardGUN(t *testing.T) {
+	cfg := TrustPinConfig{CertIDs: map[string][]string{"docker.io/*": {"aaaa"}}}
+
+	for _, gun := range []string{"docker.io/alpine", "docker.io/library/alpine"} {
+		if err := checkTrustPinning(cfg, gun, []string{"aaaa"}, nil); err != nil {
+			t.Fatalf("gun %q: expected wildcard pin to match, got: %v", gun, err)
+		}
+	}
+	if err := checkTrustPinning(cfg, "quay.io/alpine", []string{"aaaa"}, nil); err != nil {
+		t.Fatalf("gun outside the glob should fall back to TOFU, got: %v", err)
+	}
+}
+
+func TestCheckTrustPinningMostSpecificWins(t *testing.T) {
+	_, pinnedPEM := selfSignedCA(t, "specific-ca")
+	trustedDER, _ := pem.Decode(pinnedPEM)
+
+	cfg := TrustPinConfig{
+		CertIDs: map[string][]string{"docker.io/*": {"aaaa"}},
+		CA:      map[string]string{"docker.io/alpine": string(pinnedPEM)},
+	}
+
+	// The more specific CA entry should win over the broader CertIDs glob,
+	// so a root cert chaining to the pinned CA is accepted even though its
+	// key IDs don't match the CertIDs pin at all.
+	if err := checkTrustPinning(cfg, "docker.io/alpine", []string{"does-not-match"}, [][]byte{trustedDER.Bytes}); err != nil {
+		t.Fatalf("expected the more specific CA pin to win, got: %v", err)
+	}
+}
+
+func TestCheckTrustPinningTOFUDisabled(t *testing.T) {
+	cfg := TrustPinConfig{DisableTOFU: true}
+
+	if err := checkTrustPinning(cfg, "docker.io/alpine", []string{"anything"}, nil); err == nil {
+		t.Fatal("expected first-fetch to be rejected when TOFU is disabled and nothing is pinned")
+	}
+
+	cfg.CertIDs = map[string][]string{"docker.io/alpine": {"aaaa"}}
+	if err := checkTrustPinning(cfg, "docker.io/alpine", []string{"aaaa"}, nil); err != nil {
+		t.Fatalf("a pinned GUN should still be checked normally with TOFU disabled, got: %v", err)
+	}
+}